@@ -24,6 +24,8 @@ const (
 	articleUrlPrefix = "https://www.bilibili.com/read/cv"
 	musicUrlPrefix   = "https://www.bilibili.com/audio/au"
 	interval         = time.Duration(10) * time.Second
+	//短TTL缓存，避免同一轮询周期内（如WS源降级轮询与常规轮询并存时）对同一uid重复请求
+	reqCacheTTL = 3 * time.Second
 )
 
 var (
@@ -109,7 +111,7 @@ func checkBiliData(r *gjson.Result) (data *gjson.Result, code int, msg string) {
 
 // 获取用户信息
 func getInfo(mid int64) (info *LiveInfo, err error) {
-	body, err := req.Get(infoUrl, req.D{{"mid", mid}})
+	body, err := req.GetCached(infoUrl, req.D{{"mid", mid}}, reqCacheTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -226,20 +228,70 @@ const (
 type BiliDynamicSource struct {
 	uid       []int64
 	lastTable map[int64]int64
+	aiSummary bool
+	pending   []*pendingSummary
+	filter    *DynamicFilter
 }
 
+// DynOption 配置BiliDynamicSource的可选行为
+type DynOption func(*BiliDynamicSource)
+
+// WithAISummary 开启投稿视频动态的AI生成简介。简介在之后的轮询中获取，并以独立的
+// "投稿视频·AI简介"消息补发，不会追加到原动态消息的文本中
+func WithAISummary(enable bool) DynOption {
+	return func(b *BiliDynamicSource) {
+		b.aiSummary = enable
+	}
+}
+
+// WithFilter 设置动态过滤规则，未通过规则的动态不会进入推送channel
+func WithFilter(f *DynamicFilter) DynOption {
+	return func(b *BiliDynamicSource) {
+		f.compile()
+		b.filter = f
+	}
+}
+
+// filterFor 返回某个uid生效的过滤规则，存在per-uid覆盖时优先使用覆盖规则
+func (b *BiliDynamicSource) filterFor(uid int64) *DynamicFilter {
+	if b.filter == nil {
+		return nil
+	}
+	if override, ok := b.filter.PerUID[uid]; ok {
+		return override
+	}
+	return b.filter
+}
+
+// pendingSummary 记录一次因AI简介尚未生成而需要延迟重试的请求
+type pendingSummary struct {
+	bvid   string
+	cid    int64
+	mid    int64
+	author string //up主昵称，用于补发的AI简介消息标明来源
+	nextAt time.Time
+	tries  int
+}
+
+const (
+	summaryMaxRetry = 5
+	summaryRetryGap = 30 * time.Second
+)
+
 type DynamicInfo struct {
-	types  string    //动态类型
-	id     string    //动态的id，如果是视频，则是bv号
-	text   string    //动态内容
-	img    []string  //动态中的图片
-	author string    //动态作者
-	src    string    //动态链接
-	times  time.Time //动态发布时间
+	types   string    //动态类型的中文展示名，用于消息标题
+	rawType string    //动态类型，取值为DynamicType*常量，供DynamicFilter按类型过滤使用
+	id      string    //动态的id，如果是视频，则是bv号
+	text    string    //动态内容
+	img     []string  //动态中的图片
+	author  string    //动态作者
+	src     string    //动态链接
+	times   time.Time //动态发布时间
 }
 
 func (d *DynamicInfo) Reset() {
 	d.types = ""
+	d.rawType = ""
 	d.id = ""
 	d.text = ""
 	d.img = nil
@@ -247,14 +299,18 @@ func (d *DynamicInfo) Reset() {
 	d.src = ""
 }
 
-func NewBiliDynamicSource(uid []int64) *BiliDynamicSource {
+func NewBiliDynamicSource(uid []int64, opts ...DynOption) *BiliDynamicSource {
 	logger.WithFields(logrus.Fields{
 		"uid": uid,
 	}).Info("监控b站动态更新")
-	return &BiliDynamicSource{
+	b := &BiliDynamicSource{
 		uid:       uid,
 		lastTable: make(map[int64]int64),
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 func (b *BiliDynamicSource) Send(ctx context.Context, ch chan<- *push.Msg) {
@@ -266,6 +322,7 @@ func (b *BiliDynamicSource) Send(ctx context.Context, ch chan<- *push.Msg) {
 			logger.Info("停止b站动态监控")
 			return
 		case now := <-ticker.C:
+			b.retryPendingSummaries(now, ch)
 			for _, id := range b.uid {
 				infos, err := b.space(id, now)
 				if err != nil {
@@ -307,11 +364,11 @@ func (b *BiliDynamicSource) Send(ctx context.Context, ch chan<- *push.Msg) {
 
 // 获取动态
 func (b *BiliDynamicSource) space(id int64, now time.Time) (infos []*DynamicInfo, err error) {
-	resp, err := req.Get(spaceUrl, req.D{
+	resp, err := req.GetCached(spaceUrl, req.D{
 		{"offset", ""},
 		{"host_mid", id},
 		{"timezone_offset", "-480"},
-	})
+	}, reqCacheTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -333,9 +390,9 @@ func (b *BiliDynamicSource) space(id int64, now time.Time) (infos []*DynamicInfo
 		last = now.Unix() - int64(interval/time.Second)
 	}
 	for _, item := range items {
-		info := parseDynamic(&item)
+		info := parseDynamic(&item, b)
 		if info != nil {
-			if info.types == DynamicTypeLive {
+			if info.rawType == DynamicTypeLive {
 				logger.WithFields(logrus.Fields{
 					"mid":    id,
 					"author": info.author,
@@ -343,8 +400,18 @@ func (b *BiliDynamicSource) space(id int64, now time.Time) (infos []*DynamicInfo
 				}).Debug("忽略开播动态")
 				continue
 			}
+			newest = max(newest, info.times.Unix())
+			if filter := b.filterFor(id); filter != nil && !filter.allow(info) {
+				logger.WithFields(logrus.Fields{
+					"mid":  id,
+					"src":  info.src,
+					"type": info.rawType,
+				}).Debug("动态被过滤规则过滤")
+				info.Reset()
+				dynInfoPool.Put(info)
+				continue
+			}
 			second := info.times.Unix()
-			newest = max(newest, second)
 			if second > last {
 				infos = append(infos, info)
 			} else {
@@ -373,9 +440,10 @@ func max[T int64 | int | int32 | int8 | int16](a, b T) T {
 	return b
 }
 
-func parseDynamic(item *gjson.Result) *DynamicInfo {
+func parseDynamic(item *gjson.Result, src *BiliDynamicSource) *DynamicInfo {
 	types := item.Get("type").String()
 	info := dynInfoPool.Get().(*DynamicInfo)
+	info.rawType = types
 	info.id = item.Get("id_str").String()
 	info.src = dynamicUrlPrefix + info.id
 
@@ -406,15 +474,20 @@ func parseDynamic(item *gjson.Result) *DynamicInfo {
 		title := archive.Get("title").String()
 		info.text = fmt.Sprintf("%s\n%s", title, desc)
 		info.img = []string{archive.Get("cover").String()}
+		if src != nil && src.aiSummary {
+			cid := archive.Get("cid").Int()
+			mid := author.Get("mid").Int()
+			src.appendAISummary(info, mid, cid)
+		}
 	case DynamicTypeForward:
 		info.types = "转发动态"
 		text := dynamic.Get("desc.text").String()
 		orig := item.Get("orig")
-		origInfo := parseDynamic(&orig)
+		origInfo := parseDynamic(&orig, src)
 		if origInfo == nil {
 			return nil
 		}
-		if origInfo.types == DynamicTypeLive {
+		if origInfo.rawType == DynamicTypeLive {
 			info.types = "分享直播间"
 			info.text = fmt.Sprintf("%s\n分享\"%s\"的直播间\n%s", text, origInfo.author, origInfo.text)
 		} else {
@@ -442,7 +515,7 @@ func parseDynamic(item *gjson.Result) *DynamicInfo {
 		info.text = pgc.Get("title").String()
 		info.img = []string{pgc.Get("cover").String()}
 	case DynamicTypeLive:
-		info.types = DynamicTypeLive
+		info.types = "开播动态"
 		content := dynamic.Get("major.live_rcmd.content").String()
 		if content == "" {
 			return nil
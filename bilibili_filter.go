@@ -0,0 +1,85 @@
+package forwardBot
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DynamicFilter 描述BiliDynamicSource的动态过滤规则，可通过YAML配置加载，
+// 与filters:块对应，各字段留空表示不启用该项规则
+type DynamicFilter struct {
+	Allow   []string                 `yaml:"allow"`   //允许通过的动态类型（DynamicType*），为空表示不限制
+	Deny    []string                 `yaml:"deny"`    //禁止通过的动态类型，优先级高于Allow
+	Include []string                 `yaml:"include"` //text或author中需包含的子串之一，为空表示不限制
+	Exclude []string                 `yaml:"exclude"` //text或author中命中则过滤的子串
+	Regex   string                   `yaml:"regex"`   //对text的正则匹配，不匹配则过滤
+	PerUID  map[int64]*DynamicFilter `yaml:"per_uid"` //按uid覆盖的规则，存在时完全替代全局规则
+
+	re *regexp.Regexp
+}
+
+// compile 预编译正则表达式，规则生效前调用一次即可
+func (f *DynamicFilter) compile() {
+	if f == nil {
+		return
+	}
+	if f.Regex != "" {
+		re, err := regexp.Compile(f.Regex)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"regex": f.Regex,
+				"err":   err,
+			}).Warn("动态过滤正则编译失败，该规则将被忽略")
+		} else {
+			f.re = re
+		}
+	}
+	for _, sub := range f.PerUID {
+		sub.compile()
+	}
+}
+
+// allow 判断一条动态是否满足过滤规则
+func (f *DynamicFilter) allow(info *DynamicInfo) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Deny) > 0 && containsString(f.Deny, info.rawType) {
+		return false
+	}
+	if len(f.Allow) > 0 && !containsString(f.Allow, info.rawType) {
+		return false
+	}
+	if len(f.Exclude) > 0 && matchesAny(f.Exclude, info.text, info.author) {
+		return false
+	}
+	if len(f.Include) > 0 && !matchesAny(f.Include, info.text, info.author) {
+		return false
+	}
+	if f.re != nil && !f.re.MatchString(info.text) {
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, target string) bool {
+	for _, s := range list {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(keywords []string, texts ...string) bool {
+	for _, kw := range keywords {
+		for _, t := range texts {
+			if strings.Contains(t, kw) {
+				return true
+			}
+		}
+	}
+	return false
+}
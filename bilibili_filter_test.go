@@ -0,0 +1,127 @@
+package forwardBot
+
+import (
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestDynamicFilterAllowNil(t *testing.T) {
+	var f *DynamicFilter
+	if !f.allow(&DynamicInfo{rawType: DynamicTypeWord}) {
+		t.Fatal("nil filter应当放行所有动态")
+	}
+}
+
+func TestDynamicFilterAllowTypes(t *testing.T) {
+	f := &DynamicFilter{Allow: []string{DynamicTypeAV}}
+	f.compile()
+
+	if !f.allow(&DynamicInfo{rawType: DynamicTypeAV}) {
+		t.Error("Allow命中的类型应当放行")
+	}
+	if f.allow(&DynamicInfo{rawType: DynamicTypeWord}) {
+		t.Error("Allow未命中的类型应当被过滤")
+	}
+}
+
+func TestDynamicFilterDenyBeatsAllow(t *testing.T) {
+	f := &DynamicFilter{
+		Allow: []string{DynamicTypeAV, DynamicTypeWord},
+		Deny:  []string{DynamicTypeAV},
+	}
+	f.compile()
+
+	if f.allow(&DynamicInfo{rawType: DynamicTypeAV}) {
+		t.Error("Deny应当优先于Allow生效")
+	}
+	if !f.allow(&DynamicInfo{rawType: DynamicTypeWord}) {
+		t.Error("未命中Deny的类型不应被过滤")
+	}
+}
+
+// TestDynamicFilterAllowTypesEndToEnd 驱动一条真实的AV/ARTICLE动态JSON经过parseDynamic，
+// 再交给filterFor(...).allow(...)，覆盖info.types被翻译为中文展示名后，
+// 按DynamicType*常量过滤仍需在原始类型上生效的集成路径
+func TestDynamicFilterAllowTypesEndToEnd(t *testing.T) {
+	const avJSON = `{
+		"type": "DYNAMIC_TYPE_AV",
+		"id_str": "1",
+		"modules": {
+			"module_author": {"name": "UP主", "pub_ts": 1700000000, "mid": 1},
+			"module_dynamic": {"major": {"archive": {
+				"bvid": "BV1xx411c7abc", "desc": "desc", "title": "title", "cover": "cover.jpg", "cid": 1
+			}}}
+		}
+	}`
+	const articleJSON = `{
+		"type": "DYNAMIC_TYPE_ARTICLE",
+		"id_str": "2",
+		"modules": {
+			"module_author": {"name": "作者", "pub_ts": 1700000000},
+			"module_dynamic": {"major": {"article": {
+				"id": 99, "desc": "d", "title": "t", "covers": ["c.jpg"]
+			}}}
+		}
+	}`
+
+	b := &BiliDynamicSource{filter: &DynamicFilter{Allow: []string{DynamicTypeAV}}}
+	b.filter.compile()
+
+	av := gjson.Parse(avJSON)
+	avInfo := parseDynamic(&av, b)
+	if avInfo == nil {
+		t.Fatal("解析AV动态失败")
+	}
+	if !b.filterFor(1).allow(avInfo) {
+		t.Error("Allow=[DYNAMIC_TYPE_AV]应当放行AV类型的真实动态")
+	}
+
+	article := gjson.Parse(articleJSON)
+	articleInfo := parseDynamic(&article, b)
+	if articleInfo == nil {
+		t.Fatal("解析专栏动态失败")
+	}
+	if b.filterFor(1).allow(articleInfo) {
+		t.Error("Allow=[DYNAMIC_TYPE_AV]应当过滤专栏类型的真实动态")
+	}
+}
+
+func TestDynamicFilterIncludeExclude(t *testing.T) {
+	f := &DynamicFilter{
+		Include: []string{"关键词"},
+		Exclude: []string{"广告"},
+	}
+	f.compile()
+
+	if !f.allow(&DynamicInfo{text: "这是关键词动态"}) {
+		t.Error("命中Include应当放行")
+	}
+	if f.allow(&DynamicInfo{text: "无关内容"}) {
+		t.Error("未命中Include应当被过滤")
+	}
+	if f.allow(&DynamicInfo{text: "关键词广告"}) {
+		t.Error("命中Exclude应当被过滤，即使同时命中Include")
+	}
+}
+
+func TestDynamicFilterRegex(t *testing.T) {
+	f := &DynamicFilter{Regex: `^\d+$`}
+	f.compile()
+
+	if !f.allow(&DynamicInfo{text: "12345"}) {
+		t.Error("匹配正则应当放行")
+	}
+	if f.allow(&DynamicInfo{text: "abc"}) {
+		t.Error("不匹配正则应当被过滤")
+	}
+}
+
+func TestDynamicFilterInvalidRegexIgnored(t *testing.T) {
+	f := &DynamicFilter{Regex: `(`}
+	f.compile()
+
+	if !f.allow(&DynamicInfo{text: "任意内容"}) {
+		t.Error("编译失败的正则规则应被忽略，不影响放行")
+	}
+}
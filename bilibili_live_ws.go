@@ -0,0 +1,324 @@
+package forwardBot
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"forwardBot/push"
+	"forwardBot/req"
+	"io"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	liveWsUrl          = "wss://broadcastlv.chat.bilibili.com:2245/sub"
+	getRoomPlayInfoUrl = "https://api.live.bilibili.com/xlive/web-room/v1/index/getRoomPlayInfo"
+	getDanmuInfoUrl    = "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo"
+	wsHeartbeatInterval = time.Duration(30) * time.Second
+	wsMaxRetry          = 5 //超过该次数后降级为HTTP轮询
+)
+
+// 弹幕协议包头中的op字段
+const (
+	wsOpHeartbeat      = 2 //心跳
+	wsOpHeartbeatReply = 3 //心跳回复
+	wsOpSendMsg        = 5 //普通消息（房间广播）
+	wsOpAuth           = 7 //鉴权
+	wsOpAuthReply      = 8 //鉴权回复
+)
+
+const wsHeaderLen = 16 //包头长度
+
+// BiliLiveWSSource 通过b站直播弹幕WebSocket协议监控开播状态，
+// 相比BiliLiveSource的轮询方式延迟更低，同时减轻了轮询造成的请求压力。
+// 当某个房间的连接反复断开时，会自动降级为HTTP轮询。
+type BiliLiveWSSource struct {
+	uid []int64
+}
+
+func NewBiliLiveWSSource(uid []int64) *BiliLiveWSSource {
+	logger.WithFields(logrus.Fields{
+		"uid": uid,
+	}).Info("通过弹幕协议监控b站开播状态")
+	return &BiliLiveWSSource{
+		uid: append([]int64{}, uid...),
+	}
+}
+
+func (b *BiliLiveWSSource) Send(ctx context.Context, ch chan<- *push.Msg) {
+	for _, id := range b.uid {
+		id := id
+		go b.watch(ctx, id, ch)
+	}
+	<-ctx.Done()
+}
+
+// watch 负责单个uid的连接、重连与降级
+func (b *BiliLiveWSSource) watch(ctx context.Context, mid int64, ch chan<- *push.Msg) {
+	retry := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if retry >= wsMaxRetry {
+			logger.WithFields(logrus.Fields{
+				"mid": mid,
+			}).Warn("弹幕连接反复失败，降级为HTTP轮询")
+			NewBiliLiveSource([]int64{mid}).Send(ctx, ch)
+			return
+		}
+		err := b.connect(ctx, mid, ch)
+		if err == nil {
+			return //ctx被取消
+		}
+		backoff := time.Duration(1<<uint(retry)) * time.Second
+		logger.WithFields(logrus.Fields{
+			"mid":   mid,
+			"err":   err,
+			"retry": retry,
+		}).Warn("弹幕连接断开，准备重连")
+		retry++
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// wsRoomInfo 保存一个房间在WS连接生命周期内的主播信息，用于补全LIVE/PREPARING/
+// ROOM_CHANGE事件中b站推送本身不携带的昵称、标题、封面，与HTTP轮询路径输出保持一致
+type wsRoomInfo struct {
+	uname string
+	title string
+	cover string
+}
+
+// connect 建立一次弹幕连接，阻塞直到连接断开或ctx结束
+func (b *BiliLiveWSSource) connect(ctx context.Context, mid int64, ch chan<- *push.Msg) error {
+	info, err := getInfo(mid)
+	if err != nil {
+		return errors.Wrap(err, "获取房间号失败")
+	}
+	if info.Code != 0 || info.RoomId == 0 {
+		return errors.Errorf("无法解析房间号, code=%d, msg=%s", info.Code, info.Msg)
+	}
+	room := &wsRoomInfo{uname: info.Uname, title: info.Title, cover: info.Cover}
+	roomId, token, err := getDanmuAuth(info.RoomId)
+	if err != nil {
+		return errors.Wrap(err, "获取弹幕token失败")
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, liveWsUrl, nil)
+	if err != nil {
+		return errors.Wrap(err, "建立弹幕连接失败")
+	}
+	defer conn.Close()
+
+	auth, err := packAuth(roomId, token)
+	if err != nil {
+		return errors.Wrap(err, "构造鉴权包失败")
+	}
+	if err = conn.WriteMessage(websocket.BinaryMessage, auth); err != nil {
+		return errors.Wrap(err, "发送鉴权包失败")
+	}
+
+	done := make(chan struct{})
+	go b.heartbeat(conn, done)
+	defer close(done)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return errors.Wrap(err, "读取弹幕消息失败")
+		}
+		if err = b.dispatch(mid, room, data, ch); err != nil {
+			logger.WithFields(logrus.Fields{
+				"mid": mid,
+				"err": err,
+			}).Warn("解析弹幕消息失败")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+	}
+}
+
+func (b *BiliLiveWSSource) heartbeat(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(wsHeartbeatInterval)
+	defer ticker.Stop()
+	pkt := packFrame(wsOpHeartbeat, nil)
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.BinaryMessage, pkt); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dispatch 解析一帧数据，可能包含多个拼接在一起的包
+func (b *BiliLiveWSSource) dispatch(mid int64, room *wsRoomInfo, data []byte, ch chan<- *push.Msg) error {
+	for len(data) >= wsHeaderLen {
+		packLen := binary.BigEndian.Uint32(data[0:4])
+		if int(packLen) > len(data) || packLen < wsHeaderLen {
+			return errors.New("非法的弹幕包长度")
+		}
+		protoVer := binary.BigEndian.Uint16(data[6:8])
+		op := binary.BigEndian.Uint32(data[8:12])
+		body := data[wsHeaderLen:packLen]
+
+		switch op {
+		case wsOpAuthReply:
+			logger.WithFields(logrus.Fields{"mid": mid}).Debug("弹幕鉴权成功")
+		case wsOpHeartbeatReply:
+			//心跳回复，无需处理
+		case wsOpSendMsg:
+			payload, err := decompress(protoVer, body)
+			if err != nil {
+				return errors.Wrap(err, "解压弹幕消息失败")
+			}
+			b.handleCommand(mid, room, payload, ch)
+		}
+		data = data[packLen:]
+	}
+	return nil
+}
+
+// handleCommand 处理解压后的命令JSON，可能是单条也可能是嵌套的多条（protover=2/3解压后仍是弹幕帧格式）
+func (b *BiliLiveWSSource) handleCommand(mid int64, room *wsRoomInfo, payload []byte, ch chan<- *push.Msg) {
+	if len(payload) >= wsHeaderLen && binary.BigEndian.Uint32(payload[8:12]) == wsOpSendMsg {
+		//解压后仍然是完整的弹幕帧（protover=2/3的情况），递归拆包
+		_ = b.dispatch(mid, room, payload, ch)
+		return
+	}
+	cmd := gjson.GetBytes(payload, "cmd").String()
+	now := time.Now()
+	switch cmd {
+	case "LIVE":
+		msg := &push.Msg{
+			Times:  now,
+			Flag:   BiliLiveMsg,
+			Author: room.uname,
+			Title:  "开播了",
+			Text:   fmt.Sprintf("标题：\"%s\"", room.title),
+			Src:    fmt.Sprintf("%s%d", liveUrlPrefix, gjson.GetBytes(payload, "roomid").Int()),
+		}
+		if room.cover != "" {
+			msg.Img = []string{room.cover}
+		}
+		ch <- msg
+	case "PREPARING":
+		ch <- &push.Msg{
+			Times:  now,
+			Flag:   BiliLiveMsg,
+			Author: room.uname,
+			Title:  "下播了",
+			Text:   "😭😭😭",
+		}
+	case "ROOM_CHANGE":
+		room.title = gjson.GetBytes(payload, "data.title").String()
+		ch <- &push.Msg{
+			Times:  now,
+			Flag:   BiliLiveMsg,
+			Author: room.uname,
+			Title:  "直播间信息变更",
+			Text:   fmt.Sprintf("标题：\"%s\"", room.title),
+		}
+	}
+}
+
+func decompress(protoVer uint16, body []byte) ([]byte, error) {
+	switch protoVer {
+	case 0, 1:
+		return body, nil
+	case 2:
+		r, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case 3:
+		return io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+	default:
+		return nil, errors.Errorf("未知的protover: %d", protoVer)
+	}
+}
+
+// getDanmuAuth 解析短房间号为真实房间号，并获取弹幕鉴权token
+func getDanmuAuth(roomId int) (realRoomId int64, token string, err error) {
+	body, err := req.Get(getRoomPlayInfoUrl, req.D{{"room_id", roomId}})
+	if err != nil {
+		return 0, "", err
+	}
+	result, err := checkResp(body)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "read bili resp data")
+	}
+	data, code, msg := checkBiliData(result)
+	if code != 0 {
+		return 0, "", errors.Errorf("getRoomPlayInfo失败: %s", msg)
+	}
+	realRoomId = data.Get("room_id").Int()
+
+	body, err = req.Get(getDanmuInfoUrl, req.D{{"id", realRoomId}})
+	if err != nil {
+		return 0, "", err
+	}
+	result, err = checkResp(body)
+	if err != nil {
+		return 0, "", errors.Wrap(err, "read bili resp data")
+	}
+	data, code, msg = checkBiliData(result)
+	if code != 0 {
+		return 0, "", errors.Errorf("getDanmuInfo失败: %s", msg)
+	}
+	token = data.Get("token").String()
+	return realRoomId, token, nil
+}
+
+// packAuth 构造鉴权包，protocol version 3
+func packAuth(roomId int64, token string) ([]byte, error) {
+	body, err := json.Marshal(map[string]any{
+		"roomid":   roomId,
+		"uid":      0,
+		"protover": 3,
+		"platform": "web",
+		"type":     2,
+		"key":      token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return packFrame(wsOpAuth, body), nil
+}
+
+// packFrame 按[4B包长][2B头长=16][2B协议版本][4B op][4B seq]的格式封包
+func packFrame(op uint32, body []byte) []byte {
+	packLen := wsHeaderLen + len(body)
+	buf := make([]byte, packLen)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(packLen))
+	binary.BigEndian.PutUint16(buf[4:6], wsHeaderLen)
+	binary.BigEndian.PutUint16(buf[6:8], 1)
+	binary.BigEndian.PutUint32(buf[8:12], op)
+	binary.BigEndian.PutUint32(buf[12:16], 1)
+	copy(buf[wsHeaderLen:], body)
+	return buf
+}
@@ -0,0 +1,99 @@
+package forwardBot
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"forwardBot/push"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestPackFrame(t *testing.T) {
+	body := []byte(`{"roomid":123}`)
+	pkt := packFrame(wsOpAuth, body)
+
+	wantLen := wsHeaderLen + len(body)
+	if gotLen := int(binary.BigEndian.Uint32(pkt[0:4])); gotLen != wantLen {
+		t.Fatalf("包长 = %d, want %d", gotLen, wantLen)
+	}
+	if headerLen := binary.BigEndian.Uint16(pkt[4:6]); headerLen != wsHeaderLen {
+		t.Fatalf("头长 = %d, want %d", headerLen, wsHeaderLen)
+	}
+	if op := binary.BigEndian.Uint32(pkt[8:12]); op != wsOpAuth {
+		t.Fatalf("op = %d, want %d", op, wsOpAuth)
+	}
+	if got := pkt[wsHeaderLen:]; !bytes.Equal(got, body) {
+		t.Fatalf("body = %q, want %q", got, body)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	raw := []byte(`{"cmd":"LIVE"}`)
+
+	if got, err := decompress(0, raw); err != nil || !bytes.Equal(got, raw) {
+		t.Fatalf("protover=0: got (%q, %v), want (%q, nil)", got, err, raw)
+	}
+
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	_, _ = zw.Write(raw)
+	_ = zw.Close()
+	if got, err := decompress(2, zbuf.Bytes()); err != nil || !bytes.Equal(got, raw) {
+		t.Fatalf("protover=2: got (%q, %v), want (%q, nil)", got, err, raw)
+	}
+
+	var bbuf bytes.Buffer
+	bw := brotli.NewWriter(&bbuf)
+	_, _ = bw.Write(raw)
+	_ = bw.Close()
+	if got, err := decompress(3, bbuf.Bytes()); err != nil || !bytes.Equal(got, raw) {
+		t.Fatalf("protover=3: got (%q, %v), want (%q, nil)", got, err, raw)
+	}
+
+	if _, err := decompress(9, raw); err == nil {
+		t.Fatal("未知protover应返回错误")
+	}
+}
+
+func TestDispatchLiveCommand(t *testing.T) {
+	b := &BiliLiveWSSource{}
+	room := &wsRoomInfo{uname: "测试主播", title: "测试标题", cover: "https://example.com/cover.jpg"}
+	body := []byte(`{"cmd":"LIVE","roomid":123}`)
+	frame := packFrame(wsOpSendMsg, body)
+	ch := make(chan *push.Msg, 1)
+
+	if err := b.dispatch(1, room, frame, ch); err != nil {
+		t.Fatalf("dispatch返回错误: %v", err)
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Author != room.uname {
+			t.Errorf("Author = %q, want %q", msg.Author, room.uname)
+		}
+		if msg.Title != "开播了" {
+			t.Errorf("Title = %q, want 开播了", msg.Title)
+		}
+		if len(msg.Img) != 1 || msg.Img[0] != room.cover {
+			t.Errorf("Img = %v, want [%q]", msg.Img, room.cover)
+		}
+	default:
+		t.Fatal("未收到消息")
+	}
+}
+
+func TestDispatchInvalidLength(t *testing.T) {
+	b := &BiliLiveWSSource{}
+	room := &wsRoomInfo{}
+	ch := make(chan *push.Msg, 1)
+	// 声称的包长小于头长，应被判定为非法包
+	bad := make([]byte, wsHeaderLen)
+	binary.BigEndian.PutUint32(bad[0:4], 4)
+
+	if err := b.dispatch(1, room, bad, ch); err == nil {
+		t.Fatal("非法包长应返回错误")
+	}
+}
+
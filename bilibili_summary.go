@@ -0,0 +1,107 @@
+package forwardBot
+
+import (
+	"fmt"
+	"forwardBot/push"
+	"forwardBot/req"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const summaryUrl = "https://api.bilibili.com/x/web-interface/view/conclusion/get"
+
+// appendAISummary 将投稿视频加入AI简介的延迟获取队列，首次尝试同样经由该队列在下一次
+// 轮询时发起，避免在解析动态（space内层循环）时发起阻塞的同步网络请求拖慢整个轮询周期
+func (b *BiliDynamicSource) appendAISummary(info *DynamicInfo, mid, cid int64) {
+	b.pending = append(b.pending, &pendingSummary{
+		bvid:   info.id,
+		cid:    cid,
+		mid:    mid,
+		author: info.author,
+		nextAt: time.Now(),
+	})
+}
+
+// retryPendingSummaries 每次轮询时检查是否有到期的待重试AI简介请求，
+// 获取成功后以独立消息的形式补发，超过最大重试次数则放弃
+func (b *BiliDynamicSource) retryPendingSummaries(now time.Time, ch chan<- *push.Msg) {
+	if len(b.pending) == 0 {
+		return
+	}
+	remain := b.pending[:0]
+	for _, p := range b.pending {
+		if now.Before(p.nextAt) {
+			remain = append(remain, p)
+			continue
+		}
+		summary, pending, err := fetchSummary(p.bvid, p.cid, p.mid)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"bvid": p.bvid,
+				"err":  err,
+			}).Warn("重试获取AI简介失败")
+			continue
+		}
+		if pending {
+			p.tries++
+			if p.tries >= summaryMaxRetry {
+				logger.WithFields(logrus.Fields{
+					"bvid": p.bvid,
+				}).Warn("AI简介重试次数耗尽，放弃")
+				continue
+			}
+			p.nextAt = now.Add(summaryRetryGap)
+			remain = append(remain, p)
+			continue
+		}
+		if summary != "" {
+			ch <- &push.Msg{
+				Times:  now,
+				Flag:   BiliDynMsg,
+				Author: p.author,
+				Title:  "投稿视频·AI简介",
+				Text:   summary,
+				Src:    videoUrlPrefix + p.bvid,
+			}
+		}
+	}
+	b.pending = remain
+}
+
+// fetchSummary 调用b站AI总结接口，code=-1表示简介尚未生成
+// 声明为变量而非普通函数，便于测试时替换为不依赖网络的桩实现
+var fetchSummary = func(bvid string, cid, mid int64) (summary string, pending bool, err error) {
+	body, err := req.GetSigned(summaryUrl, req.D{
+		{"bvid", bvid},
+		{"cid", cid},
+		{"up_mid", mid},
+	})
+	if err != nil {
+		return "", false, err
+	}
+	result, err := checkResp(body)
+	if err != nil {
+		return "", false, err
+	}
+	code := int(result.Get("code").Int())
+	if code == -1 {
+		return "", true, nil
+	}
+	data, code, msg := checkBiliData(result)
+	if code != 0 {
+		return "", false, fmt.Errorf("获取AI简介失败: %s", msg)
+	}
+	modelResult := data.Get("model_result")
+	parts := []string{modelResult.Get("summary").String()}
+	for _, outline := range modelResult.Get("outline").Array() {
+		for _, part := range outline.Get("part_outline").Array() {
+			content := part.Get("content").String()
+			if content != "" {
+				parts = append(parts, "- "+content)
+			}
+		}
+	}
+	return strings.Join(parts, "\n"), false, nil
+}
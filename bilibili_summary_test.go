@@ -0,0 +1,126 @@
+package forwardBot
+
+import (
+	"forwardBot/push"
+	"testing"
+	"time"
+)
+
+// withStubFetchSummary临时替换fetchSummary为不访问网络的桩实现，测试结束后自动还原
+func withStubFetchSummary(t *testing.T, stub func(bvid string, cid, mid int64) (string, bool, error)) {
+	t.Helper()
+	orig := fetchSummary
+	fetchSummary = stub
+	t.Cleanup(func() { fetchSummary = orig })
+}
+
+func TestAppendAISummaryEnqueuesPending(t *testing.T) {
+	b := &BiliDynamicSource{}
+	info := &DynamicInfo{id: "BV1xx411c7abc", author: "UP主"}
+	b.appendAISummary(info, 1, 2)
+
+	if len(b.pending) != 1 {
+		t.Fatalf("pending长度 = %d, want 1", len(b.pending))
+	}
+	p := b.pending[0]
+	if p.bvid != info.id || p.mid != 1 || p.cid != 2 || p.author != info.author {
+		t.Errorf("pending内容不符: %+v", p)
+	}
+	if p.nextAt.After(time.Now()) {
+		t.Error("首次尝试应当立即到期，而不是延迟到下一次")
+	}
+}
+
+func TestRetryPendingSummariesDeliversMessage(t *testing.T) {
+	withStubFetchSummary(t, func(bvid string, cid, mid int64) (string, bool, error) {
+		return "AI简介内容", false, nil
+	})
+
+	b := &BiliDynamicSource{pending: []*pendingSummary{
+		{bvid: "BV1xx411c7abc", author: "UP主", nextAt: time.Now()},
+	}}
+	ch := make(chan *push.Msg, 1)
+	b.retryPendingSummaries(time.Now(), ch)
+
+	if len(b.pending) != 0 {
+		t.Errorf("获取成功后pending应当被清空，剩余 %d 条", len(b.pending))
+	}
+	select {
+	case msg := <-ch:
+		if msg.Author != "UP主" {
+			t.Errorf("Author = %q, want UP主", msg.Author)
+		}
+		if msg.Text != "AI简介内容" {
+			t.Errorf("Text = %q, want AI简介内容", msg.Text)
+		}
+	default:
+		t.Fatal("未收到补发的AI简介消息")
+	}
+}
+
+func TestRetryPendingSummariesNotYetGenerated(t *testing.T) {
+	withStubFetchSummary(t, func(bvid string, cid, mid int64) (string, bool, error) {
+		return "", true, nil
+	})
+
+	now := time.Now()
+	b := &BiliDynamicSource{pending: []*pendingSummary{
+		{bvid: "BV1xx411c7abc", nextAt: now},
+	}}
+	ch := make(chan *push.Msg, 1)
+	b.retryPendingSummaries(now, ch)
+
+	if len(b.pending) != 1 {
+		t.Fatalf("仍未生成简介时应当保留在pending中，剩余 %d 条", len(b.pending))
+	}
+	if got := b.pending[0].tries; got != 1 {
+		t.Errorf("tries = %d, want 1", got)
+	}
+	if !b.pending[0].nextAt.After(now) {
+		t.Error("未生成时应当推迟下一次尝试时间")
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("不应提前发送消息: %+v", msg)
+	default:
+	}
+}
+
+func TestRetryPendingSummariesGivesUpAfterMaxRetry(t *testing.T) {
+	withStubFetchSummary(t, func(bvid string, cid, mid int64) (string, bool, error) {
+		return "", true, nil
+	})
+
+	now := time.Now()
+	b := &BiliDynamicSource{pending: []*pendingSummary{
+		{bvid: "BV1xx411c7abc", nextAt: now, tries: summaryMaxRetry - 1},
+	}}
+	ch := make(chan *push.Msg, 1)
+	b.retryPendingSummaries(now, ch)
+
+	if len(b.pending) != 0 {
+		t.Fatalf("达到最大重试次数后应当放弃，剩余 %d 条", len(b.pending))
+	}
+}
+
+func TestRetryPendingSummariesNotDueYet(t *testing.T) {
+	called := false
+	withStubFetchSummary(t, func(bvid string, cid, mid int64) (string, bool, error) {
+		called = true
+		return "", false, nil
+	})
+
+	now := time.Now()
+	b := &BiliDynamicSource{pending: []*pendingSummary{
+		{bvid: "BV1xx411c7abc", nextAt: now.Add(time.Minute)},
+	}}
+	ch := make(chan *push.Msg, 1)
+	b.retryPendingSummaries(now, ch)
+
+	if called {
+		t.Error("未到期的请求不应发起fetchSummary调用")
+	}
+	if len(b.pending) != 1 {
+		t.Errorf("未到期的请求应当保留，剩余 %d 条", len(b.pending))
+	}
+}
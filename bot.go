@@ -2,8 +2,12 @@ package forwardBot
 
 import (
 	"context"
-	"fmt"
+	"forwardBot/metrics"
 	"forwardBot/push"
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -12,10 +16,52 @@ const (
 	TikTokLiveMsg
 )
 
+const (
+	defaultQueueSize   = 64
+	defaultWorkers     = 1
+	defaultMaxRetry    = 3
+	defaultBaseBackoff = time.Second
+)
+
+// SinkFilter 决定一条消息是否需要转发给对应的Sink，返回false时消息会被跳过
+type SinkFilter func(msg *push.Msg) bool
+
+// SinkOption 配置Sink注册时的队列、并发与重试行为
+type SinkOption struct {
+	Filter      SinkFilter    //为nil时转发所有消息
+	QueueSize   int           //每个Sink的有界队列大小，默认defaultQueueSize
+	Workers     int           //消费该队列的worker数量，默认defaultWorkers
+	MaxRetry    int           //投递失败后的最大重试次数，默认defaultMaxRetry
+	BaseBackoff time.Duration //重试退避基数，默认defaultBaseBackoff
+}
+
+func (o *SinkOption) fillDefault() {
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaultQueueSize
+	}
+	if o.Workers <= 0 {
+		o.Workers = defaultWorkers
+	}
+	if o.MaxRetry <= 0 {
+		o.MaxRetry = defaultMaxRetry
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = defaultBaseBackoff
+	}
+}
+
+// sinkEntry 绑定一个Sink及其独立的投递队列
+type sinkEntry struct {
+	sink  Sink
+	opt   SinkOption
+	queue chan *push.Msg
+}
+
 type Bot struct {
-	sources []Source
-	sinks   []Sink
-	ch      chan *push.Msg
+	sources    []Source
+	sinks      []*sinkEntry
+	deadLetter Sink //所有重试耗尽的消息最终投递到这里，可为nil
+	ch         chan *push.Msg
 }
 
 func NewBot(buf int) *Bot {
@@ -32,10 +78,79 @@ func (b *Bot) AppendSource(s ...Source) {
 	}
 }
 
+// AppendSink 以默认配置注册Sink，等价于AppendSinkWithOption(s, SinkOption{})
 func (b *Bot) AppendSink(s ...Sink) {
 	for _, sink := range s {
 		if sink != nil {
-			b.sinks = append(b.sinks, sink)
+			b.AppendSinkWithOption(sink, SinkOption{})
+		}
+	}
+}
+
+// AppendSinkWithOption 注册一个Sink，并指定过滤、队列、并发与重试策略
+func (b *Bot) AppendSinkWithOption(s Sink, opt SinkOption) {
+	if s == nil {
+		return
+	}
+	opt.fillDefault()
+	entry := &sinkEntry{
+		sink:  s,
+		opt:   opt,
+		queue: make(chan *push.Msg, opt.QueueSize),
+	}
+	b.sinks = append(b.sinks, entry)
+}
+
+// SetDeadLetter 设置重试耗尽后的兜底Sink，不设置时失败的消息会被直接丢弃
+func (b *Bot) SetDeadLetter(s Sink) {
+	b.deadLetter = s
+}
+
+func (b *Bot) consume(ctx context.Context, e *sinkEntry) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-e.queue:
+			b.deliver(ctx, e, msg)
+		}
+	}
+}
+
+// deliver 以指数退避+抖动重试投递，超过最大重试次数后转发到死信Sink
+// ctx取消时立即放弃剩余重试，不再阻塞在退避等待上
+func (b *Bot) deliver(ctx context.Context, e *sinkEntry, msg *push.Msg) {
+	var err error
+	for attempt := 0; attempt <= e.opt.MaxRetry; attempt++ {
+		err = e.sink.Receive(msg)
+		if err == nil {
+			return
+		}
+		if attempt == e.opt.MaxRetry {
+			break
+		}
+		metrics.SinkRetryTotal.Inc()
+		backoff := e.opt.BaseBackoff * time.Duration(1<<uint(attempt))
+		jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+		logger.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"err":     err,
+		}).Warn("消息投递失败，准备重试")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff + jitter):
+		}
+	}
+	metrics.SinkDroppedTotal.Inc()
+	logger.WithFields(logrus.Fields{
+		"err": err,
+	}).Error("消息投递失败，已超过最大重试次数")
+	if b.deadLetter != nil {
+		if dlErr := b.deadLetter.Receive(msg); dlErr != nil {
+			logger.WithFields(logrus.Fields{
+				"err": dlErr,
+			}).Error("死信队列投递也失败")
 		}
 	}
 }
@@ -44,19 +159,27 @@ func (b *Bot) Run(ctx context.Context) {
 	for _, s := range b.sources {
 		go s.Send(ctx, b.ch)
 	}
+	for _, e := range b.sinks {
+		for i := 0; i < e.opt.Workers; i++ {
+			go b.consume(ctx, e)
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case msg := <-b.ch:
-			for _, s := range b.sinks {
-				go func(s Sink) {
-					err := s.Receive(msg)
-					if err != nil {
-						//TODO
-						fmt.Println(err)
-					}
-				}(s)
+			for _, e := range b.sinks {
+				if e.opt.Filter != nil && !e.opt.Filter(msg) {
+					continue
+				}
+				metrics.SinkReceiveTotal.Inc()
+				select {
+				case e.queue <- msg:
+				default:
+					logger.Warn("sink队列已满，丢弃消息")
+					metrics.SinkDroppedTotal.Inc()
+				}
 			}
 		}
 	}
@@ -0,0 +1,53 @@
+// Package metrics 提供进程内的Prometheus风格计数器，无需额外依赖即可统计Sink投递情况
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Counter 是一个线程安全的单调递增计数器
+type Counter struct {
+	v atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Add(delta int64) {
+	c.v.Add(delta)
+}
+
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+var (
+	// SinkReceiveTotal 投递给Sink的消息总数（按Sink计数）
+	SinkReceiveTotal = &Counter{}
+	// SinkRetryTotal 投递失败后触发重试的总次数
+	SinkRetryTotal = &Counter{}
+	// SinkDroppedTotal 超过最大重试次数或队列已满而丢弃的消息总数
+	SinkDroppedTotal = &Counter{}
+)
+
+// WriteTo 以Prometheus文本暴露格式输出当前计数器快照
+func WriteTo(w io.Writer) error {
+	metrics := []struct {
+		name string
+		help string
+		c    *Counter
+	}{
+		{"sink_receive_total", "Total messages dispatched to sinks", SinkReceiveTotal},
+		{"sink_retry_total", "Total sink delivery retries", SinkRetryTotal},
+		{"sink_dropped_total", "Total messages dropped after exhausting retries or a full queue", SinkDroppedTotal},
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", m.name, m.help, m.name, m.name, m.c.Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// Package recorder 实现一个Sink，在监测到b站开播消息时自动调用ffmpeg录制直播流到本地
+package recorder
+
+import (
+	"context"
+	"forwardBot"
+	"forwardBot/push"
+	"forwardBot/req"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+)
+
+var logger = logrus.WithField("module", "recorder")
+
+const playUrlApi = "https://api.live.bilibili.com/xlive/web-room/v1/playUrl/playUrl"
+
+// Config 录制行为的配置
+type Config struct {
+	OutputDir        string        //录制文件输出目录
+	FilenameTemplate string        //文件名模板，支持{uname}、{roomid}、{time}占位符，默认"{uname}_{roomid}_{time}"
+	SegmentDuration  time.Duration //单个分段的最大时长，<=0表示不分段
+	MaxDuration      time.Duration //单次录制的最大总时长，<=0表示不限制
+	DiskQuota        int64         //OutputDir允许占用的最大字节数，<=0表示不限制
+	PostHook         string        //录制完成后执行的命令，参数为按模板生成的输出路径；分段录制时实际文件为该路径追加_%03d序号的各分段，传入的路径本身不存在
+}
+
+func (c *Config) fillDefault() {
+	if c.FilenameTemplate == "" {
+		c.FilenameTemplate = "{uname}_{roomid}_{time}"
+	}
+	if c.OutputDir == "" {
+		c.OutputDir = "."
+	}
+}
+
+// Recorder 订阅BiliLiveMsg的开播事件并录制直播流，实现了forwardBot.Sink接口
+type Recorder struct {
+	cfg Config
+
+	mu      sync.Mutex
+	running map[int]context.CancelFunc
+}
+
+func New(cfg Config) *Recorder {
+	cfg.fillDefault()
+	return &Recorder{
+		cfg:     cfg,
+		running: make(map[int]context.CancelFunc),
+	}
+}
+
+// Receive 实现Sink接口，仅对开播消息触发录制，其余消息直接忽略
+func (r *Recorder) Receive(msg *push.Msg) error {
+	if msg.Flag != forwardBot.BiliLiveMsg || msg.Title != "开播了" {
+		return nil
+	}
+	roomId, err := parseRoomId(msg.Src)
+	if err != nil {
+		return errors.Wrap(err, "解析房间号失败")
+	}
+	r.mu.Lock()
+	if _, ok := r.running[roomId]; ok {
+		r.mu.Unlock()
+		logger.WithFields(logrus.Fields{"room": roomId}).Debug("该房间已在录制中")
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.running[roomId] = cancel
+	r.mu.Unlock()
+
+	go r.record(ctx, roomId, msg.Author)
+	return nil
+}
+
+func (r *Recorder) record(ctx context.Context, roomId int, uname string) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, roomId)
+		r.mu.Unlock()
+	}()
+
+	if r.cfg.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.MaxDuration)
+		defer cancel()
+	}
+
+	streamUrl, err := getPlayUrl(roomId)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"room": roomId, "err": err}).Error("获取直播流地址失败")
+		return
+	}
+
+	if err := os.MkdirAll(r.cfg.OutputDir, 0o755); err != nil {
+		logger.WithFields(logrus.Fields{"dir": r.cfg.OutputDir, "err": err}).Error("创建输出目录失败")
+		return
+	}
+
+	stopQuota := make(chan struct{})
+	if r.cfg.DiskQuota > 0 {
+		go r.watchQuota(stopQuota)
+	}
+	defer close(stopQuota)
+
+	name := r.filename(uname, roomId)
+	out := filepath.Join(r.cfg.OutputDir, name)
+
+	args := []string{"-y", "-i", streamUrl, "-c", "copy"}
+	if r.cfg.SegmentDuration > 0 {
+		args = append(args, "-f", "segment", "-segment_time",
+			strconv.Itoa(int(r.cfg.SegmentDuration.Seconds())), "-reset_timestamps", "1",
+			strings.TrimSuffix(out, filepath.Ext(out))+"_%03d"+filepath.Ext(out))
+	} else {
+		args = append(args, out)
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	logger.WithFields(logrus.Fields{"room": roomId, "out": out}).Info("开始录制直播")
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		logger.WithFields(logrus.Fields{"room": roomId, "err": err}).Error("ffmpeg录制异常退出")
+	}
+	logger.WithFields(logrus.Fields{"room": roomId, "out": out}).Info("录制结束")
+
+	if r.cfg.PostHook != "" {
+		if err := exec.Command(r.cfg.PostHook, out).Run(); err != nil {
+			logger.WithFields(logrus.Fields{"hook": r.cfg.PostHook, "err": err}).Warn("录制后置命令执行失败")
+		}
+	}
+}
+
+// watchQuota 周期性检查输出目录占用，超出配额时删除最旧的文件
+func (r *Recorder) watchQuota(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := enforceQuota(r.cfg.OutputDir, r.cfg.DiskQuota); err != nil {
+				logger.WithFields(logrus.Fields{"err": err}).Warn("磁盘配额检查失败")
+			}
+		}
+	}
+}
+
+func enforceQuota(dir string, quota int64) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type fileInfo struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []fileInfo
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+		files = append(files, fileInfo{filepath.Join(dir, e.Name()), info.Size(), info.ModTime()})
+	}
+	if total <= quota {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= quota {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			logger.WithFields(logrus.Fields{"file": f.path, "err": err}).Warn("删除旧录制文件失败")
+			continue
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+func (r *Recorder) filename(uname string, roomId int) string {
+	now := time.Now().Format("20060102_150405")
+	name := r.cfg.FilenameTemplate
+	name = strings.ReplaceAll(name, "{uname}", sanitizeFilenamePart(uname))
+	name = strings.ReplaceAll(name, "{roomid}", strconv.Itoa(roomId))
+	name = strings.ReplaceAll(name, "{time}", now)
+	if filepath.Ext(name) == "" {
+		name += ".flv"
+	}
+	return name
+}
+
+// sanitizeFilenamePart 清理来自B站的用户昵称等外部数据，防止其中的路径分隔符、
+// ".."或空名导致最终文件写到OutputDir之外
+func sanitizeFilenamePart(s string) string {
+	s = strings.ReplaceAll(s, "/", "_")
+	s = strings.ReplaceAll(s, "\\", "_")
+	s = strings.ReplaceAll(s, "..", "_")
+	s = strings.TrimSpace(s)
+	if s == "" || s == "." {
+		s = "_"
+	}
+	return s
+}
+
+func parseRoomId(src string) (int, error) {
+	idx := strings.LastIndex(src, "/")
+	if idx < 0 {
+		return 0, errors.Errorf("无法从%q解析房间号", src)
+	}
+	return strconv.Atoi(src[idx+1:])
+}
+
+// getPlayUrl 获取直播间的FLV拉流地址
+func getPlayUrl(roomId int) (string, error) {
+	body, err := req.Get(playUrlApi, req.D{
+		{"cid", roomId},
+		{"qn", 10000},
+		{"platform", "web"},
+		{"otype", "json"},
+	})
+	if err != nil {
+		return "", err
+	}
+	result := gjson.ParseBytes(body.Bytes())
+	code := result.Get("code").Int()
+	if code != 0 {
+		return "", errors.Errorf("getPlayUrl失败: %s", result.Get("msg").String())
+	}
+	durl := result.Get("data.durl.0.url").String()
+	if durl == "" {
+		return "", errors.New("响应中无可用拉流地址")
+	}
+	return durl, nil
+}
@@ -0,0 +1,342 @@
+// Package req 封装了访问b站接口所需的限流、WBI签名、Cookie管理与响应缓存
+package req
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"golang.org/x/time/rate"
+)
+
+var logger = logrus.WithField("module", "req")
+
+// Pair 是一个请求参数键值对，D是其切片形式，便于使用复合字面量构造
+type Pair struct {
+	Key   string
+	Value any
+}
+
+// D 是请求参数列表，例如 req.D{{"mid", mid}}
+type D []Pair
+
+const (
+	navUrl       = "https://api.bilibili.com/x/web-interface/nav"
+	fingerSpiUrl = "https://api.bilibili.com/x/frontend/finger/spi"
+	wbiKeyTTL    = 12 * time.Hour
+	defaultRate  = 1 //每秒请求数
+)
+
+// Client 是带限流、WBI签名、Cookie与缓存能力的b站HTTP客户端
+type Client struct {
+	httpClient *http.Client
+
+	limiterMu sync.Mutex
+	limiters  map[string]*rate.Limiter
+	hostRate  map[string]rate.Limit //按host配置的限流速率，未配置的host使用defaultRate
+
+	cacheMu sync.Mutex
+	cache   map[string]*cacheEntry
+
+	wbiMu       sync.Mutex
+	wbiMixinKey string
+	wbiExpireAt time.Time
+}
+
+type cacheEntry struct {
+	data     []byte
+	expireAt time.Time
+}
+
+// NewClient 创建一个带Cookie管理的客户端，buvid3会在首次请求前自动获取
+func NewClient() *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		httpClient: &http.Client{Jar: jar, Timeout: 10 * time.Second},
+		limiters:   make(map[string]*rate.Limiter),
+		hostRate: map[string]rate.Limit{
+			"api.bilibili.com":      defaultRate,
+			"api.live.bilibili.com": defaultRate,
+		},
+		cache: make(map[string]*cacheEntry),
+	}
+}
+
+// DefaultClient 是req.Get等包级函数使用的默认客户端
+var DefaultClient = NewClient()
+
+// Get 使用DefaultClient发起请求，保持与历史调用方式兼容
+func Get(rawUrl string, params D) (*bytes.Buffer, error) {
+	return DefaultClient.Get(rawUrl, params)
+}
+
+// GetCached 使用DefaultClient发起请求，命中缓存时不产生实际网络请求
+func GetCached(rawUrl string, params D, ttl time.Duration) (*bytes.Buffer, error) {
+	return DefaultClient.GetCached(rawUrl, params, ttl)
+}
+
+// GetSigned 使用DefaultClient发起WBI签名请求
+func GetSigned(rawUrl string, params D) (*bytes.Buffer, error) {
+	return DefaultClient.GetSigned(rawUrl, params)
+}
+
+// Get 限流后直接发起请求，不经过缓存
+func (c *Client) Get(rawUrl string, params D) (*bytes.Buffer, error) {
+	return c.do(rawUrl, params)
+}
+
+// GetCached 在ttl有效期内复用同一URL+params的响应，超出有效期或未命中时回源并刷新缓存
+func (c *Client) GetCached(rawUrl string, params D, ttl time.Duration) (*bytes.Buffer, error) {
+	key := cacheKey(rawUrl, params)
+	c.cacheMu.Lock()
+	entry, ok := c.cache[key]
+	if ok && time.Now().Before(entry.expireAt) {
+		c.cacheMu.Unlock()
+		return bytes.NewBuffer(entry.data), nil
+	}
+	c.cacheMu.Unlock()
+
+	buf, err := c.do(rawUrl, params)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheMu.Lock()
+	c.cache[key] = &cacheEntry{data: append([]byte(nil), buf.Bytes()...), expireAt: time.Now().Add(ttl)}
+	c.cacheMu.Unlock()
+	return buf, nil
+}
+
+// GetSigned 为params附加WBI签名（w_rid、wts）后发起请求
+func (c *Client) GetSigned(rawUrl string, params D) (*bytes.Buffer, error) {
+	query, err := c.signWbi(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "wbi签名失败")
+	}
+	return c.do(rawUrl+"?"+query, nil)
+}
+
+// do 在发起请求前确保已获取buvid3，真正的网络访问委托给request
+func (c *Client) do(rawUrl string, params D) (*bytes.Buffer, error) {
+	if err := c.ensureBuvid(); err != nil {
+		logger.WithFields(logrus.Fields{"err": err}).Warn("获取buvid3失败，继续以匿名身份请求")
+	}
+	return c.request(rawUrl, params)
+}
+
+// request 是不触发ensureBuvid的底层请求方法，供ensureBuvid自身调用以避免递归
+func (c *Client) request(rawUrl string, params D) (*bytes.Buffer, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "解析url失败")
+	}
+	if len(params) > 0 {
+		q := u.Query()
+		for _, p := range params {
+			q.Set(p.Key, toString(p.Value))
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	if err := c.wait(u.Host); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(data)
+
+	if code := gjson.GetBytes(data, "code").Int(); code == -101 {
+		logger.Warn("登录态失效(-101)，清空Cookie等待重新鉴权")
+		c.resetCookies()
+	}
+	return buf, nil
+}
+
+func (c *Client) wait(host string) error {
+	c.limiterMu.Lock()
+	l, ok := c.limiters[host]
+	if !ok {
+		limit := c.hostRate[host]
+		if limit == 0 {
+			limit = defaultRate
+		}
+		l = rate.NewLimiter(limit, 1)
+		c.limiters[host] = l
+	}
+	c.limiterMu.Unlock()
+	return l.Wait(context.Background())
+}
+
+// ensureBuvid 首次请求前通过finger/spi接口获取buvid3，写入Cookie
+func (c *Client) ensureBuvid() error {
+	for _, ck := range c.httpClient.Jar.Cookies(mustParse(navUrl)) {
+		if ck.Name == "buvid3" {
+			return nil
+		}
+	}
+	buf, err := c.request(fingerSpiUrl, nil)
+	if err != nil {
+		return err
+	}
+	buvid3 := gjson.GetBytes(buf.Bytes(), "data.b_3").String()
+	if buvid3 == "" {
+		return errors.New("finger/spi未返回buvid3")
+	}
+	u := mustParse(navUrl)
+	c.httpClient.Jar.SetCookies(u, []*http.Cookie{{Name: "buvid3", Value: buvid3}})
+	return nil
+}
+
+func (c *Client) resetCookies() {
+	jar, _ := cookiejar.New(nil)
+	c.httpClient.Jar = jar
+}
+
+// SetCookies 设置SESSDATA、bili_jct等登录态Cookie
+func (c *Client) SetCookies(cookies ...*http.Cookie) {
+	c.httpClient.Jar.SetCookies(mustParse(navUrl), cookies)
+}
+
+func mustParse(rawUrl string) *url.URL {
+	u, _ := url.Parse(rawUrl)
+	return u
+}
+
+func cacheKey(rawUrl string, params D) string {
+	var b bytes.Buffer
+	b.WriteString(rawUrl)
+	for _, p := range params {
+		fmt.Fprintf(&b, "|%s=%s", p.Key, toString(p.Value))
+	}
+	return b.String()
+}
+
+func toString(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case int:
+		return strconv.Itoa(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+//mixinKeyEncTab 用于打乱img_key+sub_key得到的混合密钥
+var mixinKeyEncTab = []int{
+	46, 47, 18, 2, 53, 8, 23, 32, 15, 50, 10, 31, 58, 3, 45, 35,
+	27, 43, 5, 49, 33, 9, 42, 19, 29, 28, 14, 39, 12, 38, 41, 13,
+	37, 48, 7, 16, 24, 55, 40, 61, 26, 17, 0, 1, 60, 51, 30, 4,
+	22, 25, 54, 21, 56, 59, 6, 63, 57, 62, 11, 36, 20, 34, 44, 52,
+}
+
+// getMixinKey 获取并缓存WBI签名用的混合密钥，缓存有效期约12小时
+func (c *Client) getMixinKey() (string, error) {
+	c.wbiMu.Lock()
+	defer c.wbiMu.Unlock()
+	if c.wbiMixinKey != "" && time.Now().Before(c.wbiExpireAt) {
+		return c.wbiMixinKey, nil
+	}
+	buf, err := c.do(navUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	imgUrl := gjson.GetBytes(buf.Bytes(), "data.wbi_img.img_url").String()
+	subUrl := gjson.GetBytes(buf.Bytes(), "data.wbi_img.sub_url").String()
+	imgKey := fileNameWithoutExt(imgUrl)
+	subKey := fileNameWithoutExt(subUrl)
+	if imgKey == "" || subKey == "" {
+		return "", errors.New("获取wbi密钥失败")
+	}
+	c.wbiMixinKey = mixKey(imgKey, subKey)
+	c.wbiExpireAt = time.Now().Add(wbiKeyTTL)
+	return c.wbiMixinKey, nil
+}
+
+const wbiMixinKeyLen = 32 //WBI混合密钥的长度，mixinKeyEncTab只有前32项参与置换
+
+// mixKey 按mixinKeyEncTab打乱img_key+sub_key，取前32字节得到WBI签名用的混合密钥
+func mixKey(imgKey, subKey string) string {
+	raw := imgKey + subKey
+	mixin := make([]byte, 0, wbiMixinKeyLen)
+	for _, i := range mixinKeyEncTab[:wbiMixinKeyLen] {
+		if i < len(raw) {
+			mixin = append(mixin, raw[i])
+		}
+	}
+	return string(mixin)
+}
+
+func fileNameWithoutExt(u string) string {
+	base := u
+	if i := lastIndexByte(base, '/'); i >= 0 {
+		base = base[i+1:]
+	}
+	if i := lastIndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+func lastIndexByte(s string, b byte) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// signWbi 为params附加wts与w_rid签名，返回已编码的查询字符串
+func (c *Client) signWbi(params D) (string, error) {
+	mixinKey, err := c.getMixinKey()
+	if err != nil {
+		return "", err
+	}
+	return signParams(mixinKey, time.Now().Unix(), params), nil
+}
+
+// signParams 是signWbi中不依赖当前时间与网络请求的纯计算部分，便于单独测试
+func signParams(mixinKey string, wts int64, params D) string {
+	values := make(url.Values, len(params)+1)
+	for _, p := range params {
+		values.Set(p.Key, toString(p.Value))
+	}
+	values.Set("wts", strconv.FormatInt(wts, 10))
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	query := url.Values{}
+	for _, k := range keys {
+		query.Set(k, values.Get(k))
+	}
+	raw := query.Encode() + mixinKey
+	sum := md5.Sum([]byte(raw))
+	query.Set("w_rid", hex.EncodeToString(sum[:]))
+	return query.Encode()
+}
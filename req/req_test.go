@@ -0,0 +1,25 @@
+package req
+
+import "testing"
+
+// mixKey的测试数据取自b站WBI签名公开示例（bilibili-API-collect文档）
+func TestMixKey(t *testing.T) {
+	const imgKey = "7cd084941338484aae1ad9425b84077c"
+	const subKey = "4932caff0ff746eab6f01bf08b70ac45"
+	const want = "ea1db124af3c7062474693fa704f4ff8"
+
+	if got := mixKey(imgKey, subKey); got != want {
+		t.Fatalf("mixKey(%q, %q) = %q, want %q", imgKey, subKey, got, want)
+	}
+}
+
+func TestSignParams(t *testing.T) {
+	mixinKey := mixKey("7cd084941338484aae1ad9425b84077c", "4932caff0ff746eab6f01bf08b70ac45")
+	const wts = 1700000000
+	params := D{{"foo", "123"}, {"bar_id", "456"}}
+
+	const want = "bar_id=456&foo=123&w_rid=f0abb69eaeacbcac283263eee52f0488&wts=1700000000"
+	if got := signParams(mixinKey, wts, params); got != want {
+		t.Fatalf("signParams() = %q, want %q", got, want)
+	}
+}